@@ -0,0 +1,233 @@
+// Copyright (c) 2013, Vastech SA (PTY) LTD. All rights reserved.
+// http://code.google.com/p/gogoprotobuf
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package canonical holds the small runtime support used by code generated
+// by the canonicalhash plugin (see protoc-gen-dgo/plugin/canonical). It
+// assembles a deterministic, length-prefixed encoding of a message - fields
+// in tag order, map keys sorted, default-valued proto3 scalars omitted,
+// extensions and unrecognized bytes re-sorted by tag - and hashes it with
+// SHA-256. Two messages that are Equal according to the generated Equal
+// method always produce the same Encoder output and therefore the same
+// CanonicalHash, regardless of field declaration order, map iteration
+// order, or which wire-compatible proto runtime produced them.
+package canonical
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// Encoder accumulates the canonical, length-prefixed encoding of a message.
+// Fields must be written in ascending tag order; it is the generated code's
+// responsibility to do so for a message's own fields (known at generation
+// time) and to sort map keys and extension numbers at run time.
+type Encoder struct {
+	buf bytes.Buffer
+}
+
+// NewEncoder returns an empty Encoder.
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+// WriteField appends one length-prefixed (tag, data) entry.
+func (e *Encoder) WriteField(tag int32, data []byte) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], uint64(tag))
+	e.buf.Write(tmp[:n])
+	n = binary.PutUvarint(tmp[:], uint64(len(data)))
+	e.buf.Write(tmp[:n])
+	e.buf.Write(data)
+}
+
+// Bytes returns the accumulated canonical encoding.
+func (e *Encoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
+
+// Uvarint encodes x as a plain varint, for use as the data of a WriteField
+// call or as a building block of a larger field's data (e.g. a repeated
+// field's element count).
+func Uvarint(x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	return tmp[:n]
+}
+
+// Varint zig-zag encodes a signed integer before varint-encoding it, so that
+// small negative numbers stay small on the wire.
+func Varint(x int64) []byte {
+	return Uvarint(uint64((x << 1) ^ (x >> 63)))
+}
+
+// Fixed64 encodes x as 8 little-endian bytes (doubles, fixed64, sfixed64).
+func Fixed64(x uint64) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], x)
+	return b[:]
+}
+
+// Fixed32 encodes x as 4 little-endian bytes (floats, fixed32, sfixed32).
+func Fixed32(x uint32) []byte {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], x)
+	return b[:]
+}
+
+// Bool encodes a bool as a single 0/1 byte.
+func Bool(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// SortInt32s returns a sorted copy of keys, for ascending iteration of an
+// int32-keyed map.
+func SortInt32s(keys []int32) []int32 {
+	out := append([]int32(nil), keys...)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// SortInt64s returns a sorted copy of keys, for ascending iteration of an
+// int64-keyed map.
+func SortInt64s(keys []int64) []int64 {
+	out := append([]int64(nil), keys...)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// SortUint64s returns a sorted copy of keys, for ascending iteration of a
+// uint64/fixed64-keyed map.
+func SortUint64s(keys []uint64) []uint64 {
+	out := append([]uint64(nil), keys...)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// SortStrings returns a sorted copy of keys, for ascending iteration of a
+// string-keyed map.
+func SortStrings(keys []string) []string {
+	out := append([]string(nil), keys...)
+	sort.Strings(out)
+	return out
+}
+
+// NormalizeUnrecognized parses an XXX_unrecognized blob, merges the values
+// of duplicate length-delimited tags by concatenation (the same merge rule
+// the protobuf wire format gives repeated/unknown fields split across
+// multiple encode calls), sorts the result by tag and re-serializes it.
+// Two XXX_unrecognized blobs that are byte-for-byte different but carry the
+// same unknown data produce identical output, which is what equal_v2 needs
+// to compare unknown fields the way proto.Equal does.
+func NormalizeUnrecognized(data []byte) []byte {
+	fields := SortUnrecognized(data)
+	merged := make([]UnrecognizedField, 0, len(fields))
+	for _, f := range fields {
+		if n := len(merged); n > 0 && merged[n-1].Tag == f.Tag && merged[n-1].Wire == 2 && f.Wire == 2 {
+			merged[n-1].Value = append(merged[n-1].Value, f.Value...)
+			continue
+		}
+		merged = append(merged, f)
+	}
+	enc := NewEncoder()
+	for _, f := range merged {
+		enc.WriteField(f.Tag, append([]byte{byte(f.Wire)}, f.Value...))
+	}
+	return enc.Bytes()
+}
+
+// UnrecognizedField is one tag/value pair parsed out of an XXX_unrecognized
+// blob by SortUnrecognized.
+type UnrecognizedField struct {
+	Tag   int32
+	Wire  int32
+	Value []byte
+}
+
+// SortUnrecognized parses a wire-format XXX_unrecognized blob into
+// (tag, wire type, raw value) triples, stably sorts them by tag so that two
+// semantically identical messages hash identically regardless of the order
+// unknown fields were appended in by whichever proto runtime produced them,
+// and returns the parsed, sorted fields. Malformed input is returned as a
+// single opaque field with Tag 0 so it still contributes deterministically
+// to the hash instead of being silently dropped.
+func SortUnrecognized(data []byte) []UnrecognizedField {
+	var fields []UnrecognizedField
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			fields = append(fields, UnrecognizedField{Tag: 0, Value: data})
+			break
+		}
+		data = data[n:]
+		tag := int32(key >> 3)
+		wire := int32(key & 0x7)
+		var value []byte
+		switch wire {
+		case 0: // varint
+			_, n = binary.Uvarint(data)
+			if n <= 0 {
+				fields = append(fields, UnrecognizedField{Tag: 0, Value: data})
+				data = nil
+				continue
+			}
+			value, data = data[:n], data[n:]
+		case 1: // fixed64
+			if len(data) < 8 {
+				fields = append(fields, UnrecognizedField{Tag: 0, Value: data})
+				data = nil
+				continue
+			}
+			value, data = data[:8], data[8:]
+		case 2: // length-delimited
+			l, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < l {
+				fields = append(fields, UnrecognizedField{Tag: 0, Value: data})
+				data = nil
+				continue
+			}
+			data = data[n:]
+			value, data = data[:l], data[l:]
+		case 5: // fixed32
+			if len(data) < 4 {
+				fields = append(fields, UnrecognizedField{Tag: 0, Value: data})
+				data = nil
+				continue
+			}
+			value, data = data[:4], data[4:]
+		default:
+			fields = append(fields, UnrecognizedField{Tag: 0, Value: data})
+			data = nil
+			continue
+		}
+		fields = append(fields, UnrecognizedField{Tag: tag, Wire: wire, Value: value})
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Tag < fields[j].Tag })
+	return fields
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2013, Vastech SA (PTY) LTD. All rights reserved.
+// http://code.google.com/p/gogoprotobuf
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package difflib holds the small runtime support used by code generated by
+// the diff plugin (see protoc-gen-dgo/plugin/diff). It has no dependency on
+// the generator or on protobuf itself so that generated packages can import
+// it without pulling in the compiler.
+package difflib
+
+import "fmt"
+
+// ChangeKind classifies a single FieldDiff.
+type ChangeKind int
+
+const (
+	// Modified means the field is present on both sides but the values differ.
+	Modified ChangeKind = iota
+	// Added means the field (or repeated element) is only present on the "that" side.
+	Added
+	// Removed means the field (or repeated element) is only present on the "this" side.
+	Removed
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Modified:
+		return "modified"
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	default:
+		return fmt.Sprintf("ChangeKind(%d)", int(k))
+	}
+}
+
+// FieldDiff describes one difference between two messages, as returned by a
+// generated Diff method. Path is a human readable, dotted/indexed field path
+// such as "b.g[3]" or "m[\"key\"]". This and That hold the differing values
+// (boxed in an interface{} since fields of any type may be diffed); they are
+// left nil when not applicable to Kind.
+type FieldDiff struct {
+	Path string
+	Kind ChangeKind
+	This interface{}
+	That interface{}
+	// Unset is only meaningful when Kind is Modified: it reports whether the
+	// field should end up entirely unset (as opposed to present with a
+	// zero/default value) once this diff is applied. That is a boxed Go
+	// value and is never the nil interface for a value-typed field even when
+	// the field is unset, so Unset is the only reliable signal ApplyDiff has
+	// for a presence change.
+	Unset bool
+}
+
+func (d FieldDiff) String() string {
+	switch d.Kind {
+	case Added:
+		return fmt.Sprintf("%s: added %v", d.Path, d.That)
+	case Removed:
+		return fmt.Sprintf("%s: removed %v", d.Path, d.This)
+	default:
+		return fmt.Sprintf("%s: %v != %v", d.Path, d.This, d.That)
+	}
+}
+
+// EqualFunc reports whether two boxed repeated-field elements should be
+// considered the same element for alignment purposes.
+type EqualFunc func(this, that interface{}) bool
+
+// EditKind classifies one entry of the edit script returned by Align.
+type EditKind int
+
+const (
+	// EditEqual means this[ThisIndex] and that[ThatIndex] were matched by eq.
+	EditEqual EditKind = iota
+	// EditDelete means this[ThisIndex] has no matching element in that.
+	EditDelete
+	// EditInsert means that[ThatIndex] has no matching element in this.
+	EditInsert
+)
+
+// Edit is one step of an alignment produced by Align. ThisIndex is the
+// index into this that the edit refers to: for EditEqual/EditDelete it is
+// the matched/deleted element itself; for EditInsert, since the inserted
+// element has no counterpart in this, it is instead the index that element
+// should be inserted before (the position of the next not-yet-consumed
+// element of this, or len(this) if the insert is trailing). That anchor is
+// what lets a consumer replay a whole edit script against the original
+// slice in one pass instead of needing to re-index after every edit.
+type Edit struct {
+	Kind      EditKind
+	ThisIndex int
+	ThatIndex int
+}
+
+// Align computes a minimal edit script turning this into that, using eq to
+// decide whether two elements match. It is the classic Myers O(ND) diff,
+// which keeps the number of EditInsert/EditDelete entries proportional to
+// the number of actual insertions/deletions rather than to len(this) or
+// len(that) - the same guarantee an LCS-based diff gives, but computed in
+// O((len(this)+len(that))*D) time and O((len(this)+len(that))^2) worst case
+// space, where D is the size of the edit script.
+func Align(this, that []interface{}, eq EqualFunc) []Edit {
+	n, m := len(this), len(that)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	// trace[d] holds a copy of the v array (the furthest-reaching x for each
+	// k) as it stood before round d, i.e. after round d-1, so we can walk the
+	// path back afterwards.
+	trace := make([][]int, 0, max+1)
+	v := make([]int, 2*max+1)
+	offset := max
+
+	found := -1
+diagonals:
+	for d := 0; d <= max; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && eq(this[x], that[y]) {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = d
+				break diagonals
+			}
+		}
+	}
+
+	edits := make([]Edit, 0, found+1)
+	x, y := n, m
+	for d := found; d > 0; d-- {
+		snapshot := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && snapshot[offset+k-1] < snapshot[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := snapshot[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			edits = append(edits, Edit{Kind: EditEqual, ThisIndex: x - 1, ThatIndex: y - 1})
+			x--
+			y--
+		}
+		if x == prevX {
+			edits = append(edits, Edit{Kind: EditInsert, ThisIndex: x, ThatIndex: prevY})
+		} else {
+			edits = append(edits, Edit{Kind: EditDelete, ThisIndex: prevX})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		edits = append(edits, Edit{Kind: EditEqual, ThisIndex: x - 1, ThatIndex: y - 1})
+		x--
+		y--
+	}
+
+	// edits was built back-to-front.
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
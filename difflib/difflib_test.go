@@ -0,0 +1,159 @@
+// Copyright (c) 2013, Vastech SA (PTY) LTD. All rights reserved.
+// http://code.google.com/p/gogoprotobuf
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package difflib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func intsEqual(a, b interface{}) bool { return a.(int) == b.(int) }
+
+func box(xs []int) []interface{} {
+	b := make([]interface{}, len(xs))
+	for i, x := range xs {
+		b[i] = x
+	}
+	return b
+}
+
+func TestAlignIdentical(t *testing.T) {
+	this := []int{1, 2, 3}
+	edits := Align(box(this), box(this), intsEqual)
+	for _, e := range edits {
+		if e.Kind != EditEqual {
+			t.Fatalf("identical sequences should only produce EditEqual, got %+v", e)
+		}
+	}
+	if len(edits) != 3 {
+		t.Fatalf("expected 3 equal edits, got %d: %+v", len(edits), edits)
+	}
+}
+
+func TestAlignEmpty(t *testing.T) {
+	if edits := Align(nil, nil, intsEqual); edits != nil {
+		t.Fatalf("expected nil edits for two empty slices, got %+v", edits)
+	}
+}
+
+func TestAlignAllDeleted(t *testing.T) {
+	this := []int{1, 2, 3}
+	edits := Align(box(this), nil, intsEqual)
+	if len(edits) != 3 {
+		t.Fatalf("expected 3 deletes, got %+v", edits)
+	}
+	for i, e := range edits {
+		if e.Kind != EditDelete || e.ThisIndex != i {
+			t.Fatalf("edit %d: expected EditDelete at ThisIndex %d, got %+v", i, i, e)
+		}
+	}
+}
+
+func TestAlignAllInserted(t *testing.T) {
+	that := []int{1, 2, 3}
+	edits := Align(nil, box(that), intsEqual)
+	if len(edits) != 3 {
+		t.Fatalf("expected 3 inserts, got %+v", edits)
+	}
+	for i, e := range edits {
+		if e.Kind != EditInsert || e.ThisIndex != 0 || e.ThatIndex != i {
+			t.Fatalf("edit %d: expected EditInsert anchored at 0, got %+v", i, e)
+		}
+	}
+}
+
+// TestAlignMiddleEditsReplay is the scenario from the chunk0-1 review: this
+// = [1,2,3,4], that = [2,4], a deletion of the first and third elements.
+// Replaying the edit script in a single pass against the ORIGINAL slice
+// (rather than splicing this in place per-edit with stale indices) must
+// reproduce `that` exactly.
+func TestAlignMiddleEditsReplay(t *testing.T) {
+	this := []int{1, 2, 3, 4}
+	that := []int{2, 4}
+	edits := Align(box(this), box(that), intsEqual)
+
+	var deletes, inserts int
+	for _, e := range edits {
+		switch e.Kind {
+		case EditDelete:
+			deletes++
+		case EditInsert:
+			inserts++
+		}
+	}
+	if deletes != 2 || inserts != 0 {
+		t.Fatalf("expected exactly 2 deletes and 0 inserts for a pure subsequence, got %d deletes, %d inserts: %+v", deletes, inserts, edits)
+	}
+
+	got := replayDeleteOnly(this, edits)
+	if !reflect.DeepEqual(got, that) {
+		t.Fatalf("replay(%v, %+v) = %v, want %v", this, edits, got, that)
+	}
+}
+
+func replayDeleteOnly(this []int, edits []Edit) []int {
+	cursor := 0
+	out := make([]int, 0, len(this))
+	for _, e := range edits {
+		if e.Kind != EditDelete {
+			continue
+		}
+		out = append(out, this[cursor:e.ThisIndex]...)
+		cursor = e.ThisIndex + 1
+	}
+	out = append(out, this[cursor:]...)
+	return out
+}
+
+// TestAlignMiddleInsertReplay exercises an insert in the middle, checking
+// that EditInsert.ThisIndex anchors the new element at the right position
+// relative to the untouched elements of this.
+func TestAlignMiddleInsertReplay(t *testing.T) {
+	this := []int{1, 3}
+	that := []int{1, 2, 3}
+	edits := Align(box(this), box(that), intsEqual)
+
+	var ins *Edit
+	for i := range edits {
+		if edits[i].Kind == EditInsert {
+			ins = &edits[i]
+		}
+	}
+	if ins == nil {
+		t.Fatalf("expected an insert edit, got %+v", edits)
+	}
+
+	cursor := 0
+	out := make([]int, 0, len(this)+1)
+	out = append(out, this[cursor:ins.ThisIndex]...)
+	cursor = ins.ThisIndex
+	out = append(out, that[ins.ThatIndex])
+	out = append(out, this[cursor:]...)
+	if !reflect.DeepEqual(out, that) {
+		t.Fatalf("replay with anchor = %v, want %v", out, that)
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright (c) 2013, Vastech SA (PTY) LTD. All rights reserved.
+// http://code.google.com/p/gogoprotobuf
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+/*
+The canonicalhash plugin generates a CanonicalBytes and a CanonicalHash
+method for each message.
+
+CanonicalBytes walks the message's own fields in tag-number order (not
+declaration order), writes each as a length-prefixed (tag, value) entry via
+github.com/dropbox/goprotoc/canonical, and returns the result. Two messages
+that the generated Equal method considers equal always produce the same
+CanonicalBytes, regardless of field declaration order in the .proto, map
+iteration order, or which wire-compatible proto runtime produced them:
+default-valued proto3 scalars are omitted, map keys are sorted before
+writing, extension numbers are written in ascending order, and
+XXX_unrecognized is parsed and re-sorted by tag before being folded in.
+
+CanonicalHash returns sha256.Sum256(CanonicalBytes()), a content-addressable
+digest suitable for caches, dedup and Merkle structures.
+
+CanonicalBytes/CanonicalHash are enabled using the following extensions:
+
+  - canonical_hash
+  - canonical_hash_all
+*/
+package canonical
+
+import (
+	"github.com/dropbox/goprotoc/gogoproto"
+	"github.com/dropbox/goprotoc/protoc-gen-dgo/generator"
+	"sort"
+
+	descriptor "github.com/dropbox/goprotoc/protoc-gen-dgo/descriptor"
+)
+
+type plugin struct {
+	*generator.Generator
+	generator.PluginImports
+	fmtPkg       generator.Single
+	mathPkg      generator.Single
+	sha256Pkg    generator.Single
+	canonicalPkg generator.Single
+}
+
+func NewPlugin() *plugin {
+	return &plugin{}
+}
+
+func (p *plugin) Name() string {
+	return "canonicalhash"
+}
+
+func (p *plugin) Init(g *generator.Generator) {
+	p.Generator = g
+}
+
+func (p *plugin) Generate(file *generator.FileDescriptor) {
+	p.PluginImports = generator.NewPluginImports(p.Generator)
+	p.fmtPkg = p.NewImport("fmt")
+	p.mathPkg = p.NewImport("math")
+	p.sha256Pkg = p.NewImport("crypto/sha256")
+	p.canonicalPkg = p.NewImport("github.com/dropbox/goprotoc/canonical")
+
+	proto3 := file.GetSyntax() == "proto3"
+	for _, msg := range file.Messages() {
+		if gogoproto.HasCanonicalHash(file.FileDescriptorProto, msg.DescriptorProto) {
+			p.generateMessage(msg, proto3, gogoproto.HasExtensionsMap(file.FileDescriptorProto, msg.DescriptorProto))
+		}
+	}
+}
+
+// scalarBytesExpr returns a Go expression of type []byte that is the
+// canonical, typed encoding of expr (a non-repeated, non-map accessor of the
+// given scalar field), dispatching on the field's wire type so that, e.g., a
+// double and an int64 that happen to format to the same string under %v
+// still hash differently.
+func (p *plugin) scalarBytesExpr(field *descriptor.FieldDescriptorProto, expr string) string {
+	c := p.canonicalPkg.Use()
+	switch field.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_DOUBLE:
+		return c + `.Fixed64(` + p.mathPkg.Use() + `.Float64bits(float64(` + expr + `)))`
+	case descriptor.FieldDescriptorProto_TYPE_FLOAT:
+		return c + `.Fixed32(` + p.mathPkg.Use() + `.Float32bits(float32(` + expr + `)))`
+	case descriptor.FieldDescriptorProto_TYPE_FIXED64, descriptor.FieldDescriptorProto_TYPE_SFIXED64:
+		return c + `.Fixed64(uint64(` + expr + `))`
+	case descriptor.FieldDescriptorProto_TYPE_FIXED32, descriptor.FieldDescriptorProto_TYPE_SFIXED32:
+		return c + `.Fixed32(uint32(` + expr + `))`
+	case descriptor.FieldDescriptorProto_TYPE_UINT64, descriptor.FieldDescriptorProto_TYPE_UINT32:
+		return c + `.Uvarint(uint64(` + expr + `))`
+	case descriptor.FieldDescriptorProto_TYPE_INT64, descriptor.FieldDescriptorProto_TYPE_SINT64,
+		descriptor.FieldDescriptorProto_TYPE_INT32, descriptor.FieldDescriptorProto_TYPE_SINT32,
+		descriptor.FieldDescriptorProto_TYPE_ENUM:
+		return c + `.Varint(int64(` + expr + `))`
+	case descriptor.FieldDescriptorProto_TYPE_BOOL:
+		return c + `.Bool(bool(` + expr + `))`
+	case descriptor.FieldDescriptorProto_TYPE_STRING:
+		return `[]byte(` + expr + `)`
+	default:
+		return `[]byte(` + p.fmtPkg.Use() + `.Sprintf("%v", ` + expr + `))`
+	}
+}
+
+// mapKeySortGroup classifies a map key's wire type into one of the four
+// canonical.Sort* helpers, along with the Go slice element type to collect
+// keys into before sorting. The conversion back to the map's native key type
+// when looking the value up again is emitted by generateMessage.
+type mapKeySortGroup struct {
+	sortFunc string // e.g. "SortStrings"
+	goType   string // e.g. "string", "int32", "int64", "uint64"
+}
+
+func (p *plugin) mapKeySortGroupOf(keyField *descriptor.FieldDescriptorProto) mapKeySortGroup {
+	switch keyField.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_STRING:
+		return mapKeySortGroup{"SortStrings", "string"}
+	case descriptor.FieldDescriptorProto_TYPE_INT32, descriptor.FieldDescriptorProto_TYPE_SINT32,
+		descriptor.FieldDescriptorProto_TYPE_SFIXED32, descriptor.FieldDescriptorProto_TYPE_ENUM:
+		return mapKeySortGroup{"SortInt32s", "int32"}
+	case descriptor.FieldDescriptorProto_TYPE_UINT32, descriptor.FieldDescriptorProto_TYPE_FIXED32,
+		descriptor.FieldDescriptorProto_TYPE_UINT64, descriptor.FieldDescriptorProto_TYPE_FIXED64:
+		return mapKeySortGroup{"SortUint64s", "uint64"}
+	default:
+		// int64, sint64, sfixed64, bool: bool keys are cast to 0/1 below.
+		return mapKeySortGroup{"SortInt64s", "int64"}
+	}
+}
+
+func (p *plugin) generateMessage(message *generator.Descriptor, proto3 bool, hasExtensionsMap bool) {
+	ccTypeName := generator.CamelCaseSlice(message.TypeName())
+
+	fields := append([]*descriptor.FieldDescriptorProto(nil), message.Field...)
+	sort.Slice(fields, func(i, j int) bool { return fields[i].GetNumber() < fields[j].GetNumber() })
+
+	p.P(`func (this *`, ccTypeName, `) CanonicalBytes() []byte {`)
+	p.In()
+	p.P(`enc := `, p.canonicalPkg.Use(), `.NewEncoder()`)
+
+	for _, field := range fields {
+		fieldname := p.GetFieldName(message, field)
+		tag := field.GetNumber()
+		isMessage := field.IsMessage() || p.IsGroup(field)
+
+		writeOne := func(expr string) {
+			if isMessage {
+				p.P(`enc.WriteField(`, tag, `, `, expr, `.CanonicalBytes())`)
+			} else if field.IsBytes() {
+				p.P(`enc.WriteField(`, tag, `, `, expr, `)`)
+			} else {
+				p.P(`enc.WriteField(`, tag, `, `, p.scalarBytesExpr(field, expr), `)`)
+			}
+		}
+
+		if field.IsMap(message.DescriptorProto) {
+			keyField := field.MapKeyField(message.DescriptorProto)
+			valueField := field.MapValueField(message.DescriptorProto)
+			group := p.mapKeySortGroupOf(keyField)
+
+			p.P(`keys`, fieldname, ` := make([]`, group.goType, `, 0, len(this.`, fieldname, `))`)
+			p.P(`for k := range this.`, fieldname, ` {`)
+			p.In()
+			if keyField.GetType() == descriptor.FieldDescriptorProto_TYPE_BOOL {
+				p.P(`v := int64(0)`)
+				p.P(`if k {`)
+				p.In()
+				p.P(`v = 1`)
+				p.Out()
+				p.P(`}`)
+				p.P(`keys`, fieldname, ` = append(keys`, fieldname, `, v)`)
+			} else {
+				p.P(`keys`, fieldname, ` = append(keys`, fieldname, `, `, group.goType, `(k))`)
+			}
+			p.Out()
+			p.P(`}`)
+			p.P(`for _, k := range `, p.canonicalPkg.Use(), `.`, group.sortFunc, `(keys`, fieldname, `) {`)
+			p.In()
+			if keyField.GetType() == descriptor.FieldDescriptorProto_TYPE_BOOL {
+				p.P(`v := this.`, fieldname, `[k != 0]`)
+			} else {
+				p.P(`v := this.`, fieldname, `[`, p.GoType(keyField), `(k)]`)
+			}
+			p.P(`kv := `, p.canonicalPkg.Use(), `.NewEncoder()`)
+			if keyField.GetType() == descriptor.FieldDescriptorProto_TYPE_BOOL {
+				p.P(`kv.WriteField(1, `, p.scalarBytesExpr(keyField, `k != 0`), `)`)
+			} else {
+				p.P(`kv.WriteField(1, `, p.scalarBytesExpr(keyField, `k`), `)`)
+			}
+			if valueField.IsMessage() {
+				p.P(`kv.WriteField(2, v.CanonicalBytes())`)
+			} else if valueField.IsBytes() {
+				p.P(`kv.WriteField(2, v)`)
+			} else {
+				p.P(`kv.WriteField(2, `, p.scalarBytesExpr(valueField, `v`), `)`)
+			}
+			p.P(`enc.WriteField(`, tag, `, kv.Bytes())`)
+			p.Out()
+			p.P(`}`)
+			continue
+		}
+
+		if field.IsRepeated() {
+			p.P(`for i := 0; i < this.`, generator.SizerName(fieldname), `; i++ {`)
+			p.In()
+			writeOne(`this.` + fieldname + `[i]`)
+			p.Out()
+			p.P(`}`)
+			continue
+		}
+
+		present := `this.` + generator.SetterName(fieldname)
+		if proto3 && !isMessage {
+			if field.IsBytes() {
+				present = `len(this.` + fieldname + `) > 0`
+			} else {
+				present = `this.` + fieldname + ` != ` + generator.GoZeroLit(field)
+			}
+		}
+		p.P(`if `, present, ` {`)
+		p.In()
+		writeOne(`this.` + fieldname)
+		p.Out()
+		p.P(`}`)
+	}
+
+	if message.DescriptorProto.HasExtension() {
+		if hasExtensionsMap {
+			p.P(`extKeys := make([]int32, 0, len(this.XXX_extensions))`)
+			p.P(`for k := range this.XXX_extensions {`)
+			p.In()
+			p.P(`extKeys = append(extKeys, k)`)
+			p.Out()
+			p.P(`}`)
+			p.P(`for _, k := range `, p.canonicalPkg.Use(), `.SortInt32s(extKeys) {`)
+			p.In()
+			p.P(`v := this.XXX_extensions[k]`)
+			p.P(`data, err := v.Bytes()`)
+			p.P(`if err != nil {`)
+			p.In()
+			// Equal/VerboseEqual never panic on arbitrary input, so
+			// CanonicalBytes shouldn't either: an extension whose typed
+			// value can't be re-marshaled (unregistered descriptor,
+			// corrupt value, ...) still has to contribute deterministic
+			// bytes keyed by its tag rather than crash the caller.
+			p.P(`data = nil`)
+			p.Out()
+			p.P(`}`)
+			p.P(`enc.WriteField(k, data)`)
+			p.Out()
+			p.P(`}`)
+		} else {
+			// The non-map representation stores XXX_extensions as raw,
+			// already tag-prefixed wire bytes (like XXX_unrecognized), so
+			// it's normalized and folded in the same way: parsed by tag,
+			// sorted ascending, then re-written per extension number.
+			p.P(`for _, f := range `, p.canonicalPkg.Use(), `.SortUnrecognized(this.XXX_extensions) {`)
+			p.In()
+			p.P(`enc.WriteField(f.Tag, append([]byte{byte(f.Wire)}, f.Value...))`)
+			p.Out()
+			p.P(`}`)
+		}
+	}
+
+	p.P(`for _, f := range `, p.canonicalPkg.Use(), `.SortUnrecognized(this.XXX_unrecognized) {`)
+	p.In()
+	p.P(`enc.WriteField(f.Tag, append([]byte{byte(f.Wire)}, f.Value...))`)
+	p.Out()
+	p.P(`}`)
+
+	p.P(`return enc.Bytes()`)
+	p.Out()
+	p.P(`}`)
+	p.P(``)
+
+	p.P(`func (this *`, ccTypeName, `) CanonicalHash() [32]byte {`)
+	p.In()
+	p.P(`return `, p.sha256Pkg.Use(), `.Sum256(this.CanonicalBytes())`)
+	p.Out()
+	p.P(`}`)
+	p.P(``)
+}
+
+func init() {
+	generator.RegisterPlugin(NewPlugin())
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2013, Vastech SA (PTY) LTD. All rights reserved.
+// http://code.google.com/p/gogoprotobuf
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package canonical
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dropbox/goprotoc/protoc-gen-dgo/generator"
+
+	descriptor "github.com/dropbox/goprotoc/protoc-gen-dgo/descriptor"
+)
+
+// newTestPlugin returns a canonicalhash plugin wired up against a fresh
+// generator, ready to have generateMessage called against hand built
+// descriptors.
+func newTestPlugin() *plugin {
+	p := NewPlugin()
+	p.Init(generator.New())
+	p.PluginImports = generator.NewPluginImports(p.Generator)
+	p.fmtPkg = p.NewImport("fmt")
+	p.mathPkg = p.NewImport("math")
+	p.sha256Pkg = p.NewImport("crypto/sha256")
+	p.canonicalPkg = p.NewImport("github.com/dropbox/goprotoc/canonical")
+	return p
+}
+
+func strPtr(s string) *string { return &s }
+
+// TestGenerateMessageMapExtensionsDoesNotPanic is the regression test for
+// the chunk0-2 review finding: a malformed extension value that fails to
+// re-marshal must not crash CanonicalBytes, since Equal/VerboseEqual never
+// panic on arbitrary input either.
+func TestGenerateMessageMapExtensionsDoesNotPanic(t *testing.T) {
+	p := newTestPlugin()
+
+	desc := &generator.Descriptor{
+		DescriptorProto: &descriptor.DescriptorProto{
+			Name: strPtr("Msg"),
+			ExtensionRange: []*descriptor.DescriptorProto_ExtensionRange{
+				{Start: int32Ptr(100), End: int32Ptr(200)},
+			},
+		},
+	}
+
+	p.generateMessage(desc, false, true)
+	out := p.String()
+
+	if strings.Contains(out, `panic(`) {
+		t.Fatalf("expected CanonicalBytes to degrade gracefully instead of panicking on a bad extension, got:\n%s", out)
+	}
+	if !strings.Contains(out, `data = nil`) {
+		t.Fatalf("expected a non-panicking fallback when v.Bytes() errors, got:\n%s", out)
+	}
+}
+
+func int32Ptr(i int32) *int32 { return &i }
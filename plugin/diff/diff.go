@@ -0,0 +1,523 @@
+// Copyright (c) 2013, Vastech SA (PTY) LTD. All rights reserved.
+// http://code.google.com/p/gogoprotobuf
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+/*
+The diff plugin generates a Diff and an ApplyDiff method for each message.
+It follows the equal plugin's traversal for scalar comparison, bytes via
+bytes.Equal, nested messages via recursive Diff, extension maps and
+XXX_unrecognized, while repeated fields are aligned with difflib.Align (see
+below) rather than compared index by index. Instead of stopping at the first
+mismatch and returning a single error like VerboseEqual, it collects every
+difference into a structured slice of
+github.com/dropbox/goprotoc/difflib.FieldDiff values. Oneof and map fields
+get no dedicated handling: a oneof member goes through the plain-field path
+and a map field through the repeated-field path.
+
+Diff is enabled using the following extensions:
+
+  - diff
+  - diff_all
+
+Given the same B message used to document the equal plugin:
+
+  option (gogoproto.diff_all) = true;
+
+  message B {
+	optional string A = 1 [(gogoproto.embed) = true];
+	repeated int64 G = 2 [(gogoproto.customtype) = "github.com/dropbox/goprotoc/test.Id"];
+  }
+
+the diff plugin generates:
+
+	func (this *B) Diff(that interface{}) []difflib.FieldDiff {
+		var diffs []difflib.FieldDiff
+		that1, ok := that.(*B)
+		if !ok {
+			return append(diffs, difflib.FieldDiff{Path: "", Kind: difflib.Modified, This: this, That: that})
+		}
+		if this == nil && that1 == nil {
+			return nil
+		}
+		if this == nil || that1 == nil {
+			return append(diffs, difflib.FieldDiff{Path: "", Kind: difflib.Modified, This: this, That: that1})
+		}
+		if this.xxx_IsASet != that1.xxx_IsASet {
+			...
+		}
+		...
+		return diffs
+	}
+
+	func (this *B) ApplyDiff(diffs []difflib.FieldDiff) error {
+		var diffsForg []difflib.FieldDiff
+		for _, d := range diffs {
+			if strings.HasPrefix(d.Path, "g[") {
+				diffsForg = append(diffsForg, d)
+				continue
+			}
+			switch {
+			case d.Path == "a":
+				...
+			}
+		}
+		if len(diffsForg) > 0 {
+			...
+		}
+		return nil
+	}
+
+Repeated fields are aligned with difflib.Align (an O(ND) Myers diff), so an
+insertion or deletion in the middle of a repeated field produces one Added
+or Removed FieldDiff per changed element instead of one Modified FieldDiff
+per element from the point of the change onwards. ApplyDiff collects a
+repeated field's "g[3]"-style indexed diffs as it scans and replays all of
+them against the original slice in a single pass once the scan is done,
+since their indices are only valid against that original slice - splicing
+each one in place as it's seen would shift every later index out from under
+it. Dotted "b.sub" paths from a nested message's Diff are routed straight
+to the right typed field's ApplyDiff (a nil field is first allocated with
+reflect.New), and
+XXX_unrecognized/XXX_extensions (for the byte-slice extension
+representation) are matched like any other bytes field. Diffs against a
+map-typed extensions field are not yet patchable; ApplyDiff returns an
+error for those paths.
+*/
+package diff
+
+import (
+	"github.com/dropbox/goprotoc/gogoproto"
+	"github.com/dropbox/goprotoc/protoc-gen-dgo/generator"
+
+	descriptor "github.com/dropbox/goprotoc/protoc-gen-dgo/descriptor"
+)
+
+type plugin struct {
+	*generator.Generator
+	generator.PluginImports
+	bytesPkg   generator.Single
+	fmtPkg     generator.Single
+	strconvPkg generator.Single
+	stringsPkg generator.Single
+	difflibPkg generator.Single
+}
+
+func NewPlugin() *plugin {
+	return &plugin{}
+}
+
+func (p *plugin) Name() string {
+	return "diff"
+}
+
+func (p *plugin) Init(g *generator.Generator) {
+	p.Generator = g
+}
+
+func (p *plugin) Generate(file *generator.FileDescriptor) {
+	p.PluginImports = generator.NewPluginImports(p.Generator)
+	p.bytesPkg = p.NewImport("bytes")
+	p.fmtPkg = p.NewImport("fmt")
+	p.strconvPkg = p.NewImport("strconv")
+	p.stringsPkg = p.NewImport("strings")
+	p.difflibPkg = p.NewImport("github.com/dropbox/goprotoc/difflib")
+
+	for _, msg := range file.Messages() {
+		if gogoproto.HasDiff(file.FileDescriptorProto, msg.DescriptorProto) {
+			hasExtensionsMap := gogoproto.HasExtensionsMap(file.FileDescriptorProto, msg.DescriptorProto)
+			p.generateDiff(msg, hasExtensionsMap)
+			p.generateApplyDiff(msg, hasExtensionsMap)
+		}
+	}
+}
+
+func (p *plugin) diffLit(kind string) string {
+	return p.difflibPkg.Use() + `.` + kind
+}
+
+func (p *plugin) generateDiff(message *generator.Descriptor, hasExtensionsMap bool) {
+	ccTypeName := generator.CamelCaseSlice(message.TypeName())
+
+	p.P(`func (this *`, ccTypeName, `) Diff(that interface{}) []`, p.difflibPkg.Use(), `.FieldDiff {`)
+	p.In()
+	p.P(`var diffs []`, p.difflibPkg.Use(), `.FieldDiff`)
+	p.P(`that1, ok := that.(*`, ccTypeName, `)`)
+	p.P(`if !ok {`)
+	p.In()
+	p.P(`return append(diffs, `, p.difflibPkg.Use(), `.FieldDiff{Path: "", Kind: `, p.diffLit("Modified"), `, This: this, That: that})`)
+	p.Out()
+	p.P(`}`)
+	p.P(`if this == nil && that1 == nil {`)
+	p.In()
+	p.P(`return nil`)
+	p.Out()
+	p.P(`}`)
+	p.P(`if this == nil || that1 == nil {`)
+	p.In()
+	p.P(`return append(diffs, `, p.difflibPkg.Use(), `.FieldDiff{Path: "", Kind: `, p.diffLit("Modified"), `, This: this, That: that1})`)
+	p.Out()
+	p.P(`}`)
+
+	for _, field := range message.Field {
+		fieldname := p.GetFieldName(message, field)
+		repeated := field.IsRepeated()
+		if !repeated {
+			if field.IsMessage() || p.IsGroup(field) {
+				p.P(`if this.`, generator.SetterName(fieldname), ` != that1.`, generator.SetterName(fieldname), ` {`)
+				p.In()
+				p.P(`diffs = append(diffs, `, p.difflibPkg.Use(), `.FieldDiff{Path: "`, fieldname, `", Kind: `, p.diffLit("Modified"), `, This: this.`, fieldname, `, That: that1.`, fieldname, `, Unset: !that1.`, generator.SetterName(fieldname), `})`)
+				p.Out()
+				p.P(`} else if this.`, generator.SetterName(fieldname), ` {`)
+				p.In()
+				p.P(`for _, d := range this.`, fieldname, `.Diff(that1.`, fieldname, `) {`)
+				p.In()
+				p.P(`d.Path = "`, fieldname, `." + d.Path`)
+				p.P(`diffs = append(diffs, d)`)
+				p.Out()
+				p.P(`}`)
+				p.Out()
+				p.P(`}`)
+			} else if field.IsBytes() {
+				p.P(`if this.`, generator.SetterName(fieldname), ` != that1.`, generator.SetterName(fieldname), ` || (this.`, generator.SetterName(fieldname), ` && !`, p.bytesPkg.Use(), `.Equal(this.`, fieldname, `, that1.`, fieldname, `)) {`)
+				p.In()
+				p.P(`diffs = append(diffs, `, p.difflibPkg.Use(), `.FieldDiff{Path: "`, fieldname, `", Kind: `, p.diffLit("Modified"), `, This: this.`, fieldname, `, That: that1.`, fieldname, `, Unset: !that1.`, generator.SetterName(fieldname), `})`)
+				p.Out()
+				p.P(`}`)
+			} else {
+				p.P(`if this.`, generator.SetterName(fieldname), ` != that1.`, generator.SetterName(fieldname), ` || (this.`, generator.SetterName(fieldname), ` && this.`, fieldname, ` != that1.`, fieldname, `) {`)
+				p.In()
+				p.P(`diffs = append(diffs, `, p.difflibPkg.Use(), `.FieldDiff{Path: "`, fieldname, `", Kind: `, p.diffLit("Modified"), `, This: this.`, fieldname, `, That: that1.`, fieldname, `, Unset: !that1.`, generator.SetterName(fieldname), `})`)
+				p.Out()
+				p.P(`}`)
+			}
+		} else {
+			p.P(`{`)
+			p.In()
+			p.P(`thisBox := make([]interface{}, this.`, generator.SizerName(fieldname), `)`)
+			p.P(`for i := 0; i < this.`, generator.SizerName(fieldname), `; i++ {`)
+			p.In()
+			p.P(`thisBox[i] = this.`, fieldname, `[i]`)
+			p.Out()
+			p.P(`}`)
+			p.P(`thatBox := make([]interface{}, that1.`, generator.SizerName(fieldname), `)`)
+			p.P(`for i := 0; i < that1.`, generator.SizerName(fieldname), `; i++ {`)
+			p.In()
+			p.P(`thatBox[i] = that1.`, fieldname, `[i]`)
+			p.Out()
+			p.P(`}`)
+			p.P(`for _, e := range `, p.difflibPkg.Use(), `.Align(thisBox, thatBox, func(a, b interface{}) bool {`)
+			p.In()
+			if field.IsMessage() || p.IsGroup(field) {
+				p.P(`return a.(`, p.TypeName(field), `).Equal(b.(`, p.TypeName(field), `))`)
+			} else if field.IsBytes() {
+				p.P(`return `, p.bytesPkg.Use(), `.Equal(a.([]byte), b.([]byte))`)
+			} else {
+				p.P(`return a == b`)
+			}
+			p.Out()
+			p.P(`}) {`)
+			p.In()
+			p.P(`switch e.Kind {`)
+			p.P(`case `, p.difflibPkg.Use(), `.EditDelete:`)
+			p.In()
+			p.P(`diffs = append(diffs, `, p.difflibPkg.Use(), `.FieldDiff{Path: `, p.fmtPkg.Use(), `.Sprintf("`, fieldname, `[%d]", e.ThisIndex), Kind: `, p.diffLit("Removed"), `, This: this.`, fieldname, `[e.ThisIndex]})`)
+			p.Out()
+			p.P(`case `, p.difflibPkg.Use(), `.EditInsert:`)
+			p.In()
+			p.P(`diffs = append(diffs, `, p.difflibPkg.Use(), `.FieldDiff{Path: `, p.fmtPkg.Use(), `.Sprintf("`, fieldname, `[%d]", e.ThisIndex), Kind: `, p.diffLit("Added"), `, That: that1.`, fieldname, `[e.ThatIndex]})`)
+			p.Out()
+			p.Out()
+			p.P(`}`)
+			p.Out()
+			p.P(`}`)
+			p.Out()
+			p.P(`}`)
+		}
+	}
+
+	if message.DescriptorProto.HasExtension() {
+		fieldname := "XXX_extensions"
+		if hasExtensionsMap {
+			p.P(`for k, v := range this.`, fieldname, ` {`)
+			p.In()
+			p.P(`if v2, ok := that1.`, fieldname, `[k]; ok {`)
+			p.In()
+			p.P(`if !v.Equal(&v2) {`)
+			p.In()
+			p.P(`diffs = append(diffs, `, p.difflibPkg.Use(), `.FieldDiff{Path: `, p.fmtPkg.Use(), `.Sprintf("`, fieldname, `[%v]", k), Kind: `, p.diffLit("Modified"), `, This: this.`, fieldname, `[k], That: that1.`, fieldname, `[k]})`)
+			p.Out()
+			p.P(`}`)
+			p.Out()
+			p.P(`} else {`)
+			p.In()
+			p.P(`diffs = append(diffs, `, p.difflibPkg.Use(), `.FieldDiff{Path: `, p.fmtPkg.Use(), `.Sprintf("`, fieldname, `[%v]", k), Kind: `, p.diffLit("Removed"), `, This: this.`, fieldname, `[k]})`)
+			p.Out()
+			p.P(`}`)
+			p.Out()
+			p.P(`}`)
+			p.P(`for k, v2 := range that1.`, fieldname, ` {`)
+			p.In()
+			p.P(`if _, ok := this.`, fieldname, `[k]; !ok {`)
+			p.In()
+			p.P(`diffs = append(diffs, `, p.difflibPkg.Use(), `.FieldDiff{Path: `, p.fmtPkg.Use(), `.Sprintf("`, fieldname, `[%v]", k), Kind: `, p.diffLit("Added"), `, That: v2})`)
+			p.Out()
+			p.P(`}`)
+			p.Out()
+			p.P(`}`)
+		} else {
+			p.P(`if !`, p.bytesPkg.Use(), `.Equal(this.`, fieldname, `, that1.`, fieldname, `) {`)
+			p.In()
+			p.P(`diffs = append(diffs, `, p.difflibPkg.Use(), `.FieldDiff{Path: "`, fieldname, `", Kind: `, p.diffLit("Modified"), `, This: this.`, fieldname, `, That: that1.`, fieldname, `})`)
+			p.Out()
+			p.P(`}`)
+		}
+	}
+
+	fieldname := "XXX_unrecognized"
+	p.P(`if !`, p.bytesPkg.Use(), `.Equal(this.`, fieldname, `, that1.`, fieldname, `) {`)
+	p.In()
+	p.P(`diffs = append(diffs, `, p.difflibPkg.Use(), `.FieldDiff{Path: "`, fieldname, `", Kind: `, p.diffLit("Modified"), `, This: this.`, fieldname, `, That: that1.`, fieldname, `})`)
+	p.Out()
+	p.P(`}`)
+	p.P(`return diffs`)
+	p.Out()
+	p.P(`}`)
+	p.P(``)
+}
+
+// repeatedEditsVar names the slice that accumulates a repeated field's
+// Added/Removed diffs while the main diffs loop is diverting them, so they
+// can be replayed against the original slice in one pass afterwards instead
+// of splicing this.<field> in place diff-by-diff. Splicing in place would
+// invalidate every later diff's index, since those indices were all
+// computed by difflib.Align against the pre-mutation slice.
+func repeatedEditsVar(fieldname string) string {
+	return "diffsFor" + fieldname
+}
+
+// generateApplyDiff emits ApplyDiff, which mutates the receiver in place so
+// that it matches whatever the other side of a previously computed Diff was.
+// Top-level scalar/bytes/message fields (including XXX_unrecognized and, for
+// the non-map extension representation, XXX_extensions) are matched on an
+// exact Path; a nested message's dotted "field.sub..." paths are routed to
+// that field's own ApplyDiff (the field's concrete type is known at
+// generation time, so the call is direct; a nil field is first allocated
+// with reflect.New). A repeated field's indexed
+// "field[n]" diffs are collected as the main loop runs and replayed against
+// the original slice in a single pass once the loop is done, so that n
+// always refers to the pre-mutation slice Align computed it against, no
+// matter how many edits the same field has. Extension-map diffs are not yet
+// patchable and fall through to the default error case.
+func (p *plugin) generateApplyDiff(message *generator.Descriptor, hasExtensionsMap bool) {
+	ccTypeName := generator.CamelCaseSlice(message.TypeName())
+
+	var repeatedFields []*descriptor.FieldDescriptorProto
+	for _, field := range message.Field {
+		if field.IsRepeated() {
+			repeatedFields = append(repeatedFields, field)
+		}
+	}
+
+	p.P(`func (this *`, ccTypeName, `) ApplyDiff(diffs []`, p.difflibPkg.Use(), `.FieldDiff) error {`)
+	p.In()
+	for _, field := range repeatedFields {
+		fieldname := p.GetFieldName(message, field)
+		p.P(`var `, repeatedEditsVar(fieldname), ` []`, p.difflibPkg.Use(), `.FieldDiff`)
+	}
+	p.P(`for _, d := range diffs {`)
+	p.In()
+	for _, field := range repeatedFields {
+		fieldname := p.GetFieldName(message, field)
+		p.P(`if `, p.stringsPkg.Use(), `.HasPrefix(d.Path, "`, fieldname, `[") {`)
+		p.In()
+		p.P(repeatedEditsVar(fieldname), ` = append(`, repeatedEditsVar(fieldname), `, d)`)
+		p.P(`continue`)
+		p.Out()
+		p.P(`}`)
+	}
+	p.P(`switch {`)
+	for _, field := range message.Field {
+		if field.IsRepeated() {
+			continue
+		}
+		fieldname := p.GetFieldName(message, field)
+		isMessage := field.IsMessage() || p.IsGroup(field)
+
+		if isMessage {
+			p.P(`case d.Path == "`, fieldname, `":`)
+			p.In()
+			p.P(`if d.Unset {`)
+			p.In()
+			p.P(`this.`, fieldname, ` = nil`)
+			p.P(`this.`, generator.SetterName(fieldname), ` = false`)
+			p.Out()
+			p.P(`} else {`)
+			p.In()
+			p.P(`this.`, fieldname, ` = d.That.(`, p.TypeName(field), `)`)
+			p.P(`this.`, generator.SetterName(fieldname), ` = true`)
+			p.Out()
+			p.P(`}`)
+			p.Out()
+			p.P(`case `, p.stringsPkg.Use(), `.HasPrefix(d.Path, "`, fieldname, `."):`)
+			p.In()
+			p.P(`if this.`, fieldname, ` == nil {`)
+			p.In()
+			reflectPkg := p.NewImport("reflect")
+			p.P(`this.`, fieldname, ` = `, reflectPkg.Use(), `.New(`, reflectPkg.Use(), `.TypeOf(this.`, fieldname, `).Elem()).Interface().(`, p.TypeName(field), `)`)
+			p.Out()
+			p.P(`}`)
+			p.P(`sub := d`)
+			p.P(`sub.Path = `, p.stringsPkg.Use(), `.TrimPrefix(d.Path, "`, fieldname, `.")`)
+			p.P(`if err := this.`, fieldname, `.ApplyDiff([]`, p.difflibPkg.Use(), `.FieldDiff{sub}); err != nil {`)
+			p.In()
+			p.P(`return err`)
+			p.Out()
+			p.P(`}`)
+			p.P(`this.`, generator.SetterName(fieldname), ` = true`)
+			p.Out()
+			continue
+		}
+
+		p.P(`case d.Path == "`, fieldname, `":`)
+		p.In()
+		p.P(`if d.Unset {`)
+		p.In()
+		if field.IsBytes() {
+			p.P(`this.`, fieldname, ` = nil`)
+		} else {
+			p.P(`this.`, fieldname, ` = `, generator.GoZeroLit(field))
+		}
+		p.P(`this.`, generator.SetterName(fieldname), ` = false`)
+		p.Out()
+		p.P(`} else {`)
+		p.In()
+		if field.IsBytes() {
+			p.P(`this.`, fieldname, ` = d.That.([]byte)`)
+		} else {
+			p.P(`this.`, fieldname, ` = d.That.(`, p.GoType(field), `)`)
+		}
+		p.P(`this.`, generator.SetterName(fieldname), ` = true`)
+		p.Out()
+		p.P(`}`)
+		p.Out()
+	}
+	if message.DescriptorProto.HasExtension() && !hasExtensionsMap {
+		p.P(`case d.Path == "XXX_extensions":`)
+		p.In()
+		p.P(`if d.Unset {`)
+		p.In()
+		p.P(`this.XXX_extensions = nil`)
+		p.Out()
+		p.P(`} else {`)
+		p.In()
+		p.P(`this.XXX_extensions = d.That.([]byte)`)
+		p.Out()
+		p.P(`}`)
+		p.Out()
+	}
+	p.P(`case d.Path == "XXX_unrecognized":`)
+	p.In()
+	p.P(`if d.Unset {`)
+	p.In()
+	p.P(`this.XXX_unrecognized = nil`)
+	p.Out()
+	p.P(`} else {`)
+	p.In()
+	p.P(`this.XXX_unrecognized = d.That.([]byte)`)
+	p.Out()
+	p.P(`}`)
+	p.Out()
+	p.P(`default:`)
+	p.In()
+	p.P(`return `, p.fmtPkg.Use(), `.Errorf("ApplyDiff: unsupported path %q (extension map diffs are not yet patchable)", d.Path)`)
+	p.Out()
+	p.P(`}`)
+	p.Out()
+	p.P(`}`)
+
+	for _, field := range repeatedFields {
+		fieldname := p.GetFieldName(message, field)
+		isMessage := field.IsMessage() || p.IsGroup(field)
+		var elemType string
+		if isMessage {
+			elemType = p.TypeName(field)
+		} else if field.IsBytes() {
+			elemType = "[]byte"
+		} else {
+			elemType = p.GoType(field)
+		}
+
+		p.P(`if len(`, repeatedEditsVar(fieldname), `) > 0 {`)
+		p.In()
+		p.P(`orig`, fieldname, ` := this.`, fieldname)
+		p.P(`cursor`, fieldname, ` := 0`)
+		p.P(`rebuilt`, fieldname, ` := make([]`, elemType, `, 0, len(orig`, fieldname, `))`)
+		p.P(`for _, d := range `, repeatedEditsVar(fieldname), ` {`)
+		p.In()
+		p.P(`idxStr := `, p.stringsPkg.Use(), `.TrimSuffix(`, p.stringsPkg.Use(), `.TrimPrefix(d.Path, "`, fieldname, `["), "]")`)
+		p.P(`idx, err := `, p.strconvPkg.Use(), `.Atoi(idxStr)`)
+		p.P(`if err != nil {`)
+		p.In()
+		p.P(`return `, p.fmtPkg.Use(), `.Errorf("ApplyDiff: bad index in path %q: %v", d.Path, err)`)
+		p.Out()
+		p.P(`}`)
+		p.P(`if idx < cursor`, fieldname, ` || idx > len(orig`, fieldname, `) {`)
+		p.In()
+		p.P(`return `, p.fmtPkg.Use(), `.Errorf("ApplyDiff: index out of range in path %q", d.Path)`)
+		p.Out()
+		p.P(`}`)
+		p.P(`switch d.Kind {`)
+		p.P(`case `, p.difflibPkg.Use(), `.Removed:`)
+		p.In()
+		p.P(`rebuilt`, fieldname, ` = append(rebuilt`, fieldname, `, orig`, fieldname, `[cursor`, fieldname, `:idx]...)`)
+		p.P(`cursor`, fieldname, ` = idx + 1`)
+		p.Out()
+		p.P(`case `, p.difflibPkg.Use(), `.Added:`)
+		p.In()
+		p.P(`rebuilt`, fieldname, ` = append(rebuilt`, fieldname, `, orig`, fieldname, `[cursor`, fieldname, `:idx]...)`)
+		p.P(`cursor`, fieldname, ` = idx`)
+		p.P(`rebuilt`, fieldname, ` = append(rebuilt`, fieldname, `, d.That.(`, elemType, `))`)
+		p.Out()
+		p.P(`default:`)
+		p.In()
+		p.P(`return `, p.fmtPkg.Use(), `.Errorf("ApplyDiff: unexpected diff kind for repeated path %q", d.Path)`)
+		p.Out()
+		p.P(`}`)
+		p.Out()
+		p.P(`}`)
+		p.P(`rebuilt`, fieldname, ` = append(rebuilt`, fieldname, `, orig`, fieldname, `[cursor`, fieldname, `:]...)`)
+		p.P(`this.`, fieldname, ` = rebuilt`, fieldname)
+		p.Out()
+		p.P(`}`)
+	}
+
+	p.P(`return nil`)
+	p.Out()
+	p.P(`}`)
+}
+
+func init() {
+	generator.RegisterPlugin(NewPlugin())
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2013, Vastech SA (PTY) LTD. All rights reserved.
+// http://code.google.com/p/gogoprotobuf
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dropbox/goprotoc/protoc-gen-dgo/generator"
+
+	descriptor "github.com/dropbox/goprotoc/protoc-gen-dgo/descriptor"
+)
+
+// newTestPlugin returns a diff plugin wired up against a fresh generator,
+// ready to have generateDiff/generateApplyDiff called against hand built
+// descriptors. This drives the same code path Generate does, without
+// needing a real protoc invocation.
+func newTestPlugin() *plugin {
+	p := NewPlugin()
+	p.Init(generator.New())
+	p.PluginImports = generator.NewPluginImports(p.Generator)
+	p.bytesPkg = p.NewImport("bytes")
+	p.fmtPkg = p.NewImport("fmt")
+	p.strconvPkg = p.NewImport("strconv")
+	p.stringsPkg = p.NewImport("strings")
+	p.difflibPkg = p.NewImport("github.com/dropbox/goprotoc/difflib")
+	return p
+}
+
+func strPtr(s string) *string { return &s }
+func int32Ptr(i int32) *int32 { return &i }
+
+func labelRepeated() *descriptor.FieldDescriptorProto_Label {
+	l := descriptor.FieldDescriptorProto_LABEL_REPEATED
+	return &l
+}
+
+func typePtr(t descriptor.FieldDescriptorProto_Type) *descriptor.FieldDescriptorProto_Type {
+	return &t
+}
+
+// TestGenerateApplyDiffReplaysRepeatedFieldInOnePass is the regression test
+// for the chunk0-1 review finding: ApplyDiff must collect a repeated
+// field's Added/Removed diffs and replay them against the ORIGINAL slice in
+// one pass, not splice this.<field> in place diff-by-diff (which corrupts
+// the result as soon as a single call carries more than one edit for the
+// same field, since later indices were computed against the pre-mutation
+// slice).
+func TestGenerateApplyDiffReplaysRepeatedFieldInOnePass(t *testing.T) {
+	p := newTestPlugin()
+
+	field := &descriptor.FieldDescriptorProto{
+		Name:   strPtr("g"),
+		Number: int32Ptr(1),
+		Label:  labelRepeated(),
+		Type:   typePtr(descriptor.FieldDescriptorProto_TYPE_INT32),
+	}
+	desc := &generator.Descriptor{
+		DescriptorProto: &descriptor.DescriptorProto{
+			Name:  strPtr("Msg"),
+			Field: []*descriptor.FieldDescriptorProto{field},
+		},
+	}
+
+	p.generateApplyDiff(desc, false)
+	out := p.String()
+
+	if !strings.Contains(out, `var diffsForG []`) {
+		t.Fatalf("expected ApplyDiff to collect G's diffs into a bucket before replaying them, got:\n%s", out)
+	}
+	if !strings.Contains(out, `rebuiltG := make(`) || !strings.Contains(out, `this.G = rebuiltG`) {
+		t.Fatalf("expected ApplyDiff to rebuild G in one pass and assign it once, got:\n%s", out)
+	}
+	if strings.Contains(out, `append(this.G[:idx]`) {
+		t.Fatalf("expected no in-place splice of this.G (stale-index bug), got:\n%s", out)
+	}
+}
+
+// TestGenerateApplyDiffPatchesUnrecognized is the regression test for the
+// second chunk0-1 review finding: Diff emits FieldDiffs for XXX_unrecognized
+// (and, for the byte-slice extension representation, XXX_extensions), so
+// ApplyDiff must have matching cases instead of falling through to the
+// "unsupported path" default.
+func TestGenerateApplyDiffPatchesUnrecognized(t *testing.T) {
+	p := newTestPlugin()
+
+	desc := &generator.Descriptor{
+		DescriptorProto: &descriptor.DescriptorProto{
+			Name: strPtr("Msg"),
+		},
+	}
+
+	p.generateApplyDiff(desc, false)
+	out := p.String()
+
+	if !strings.Contains(out, `case d.Path == "XXX_unrecognized":`) {
+		t.Fatalf("expected a case patching XXX_unrecognized, got:\n%s", out)
+	}
+}
+
+// TestGenerateDiffAddedPathAnchorsOnThis checks that an Added FieldDiff's
+// Path uses the edit's ThisIndex (the position in the original slice the
+// insertion is anchored to), not ThatIndex, so that ApplyDiff's single-pass
+// replay can locate where to splice the new element in without needing a
+// second, separately indexed source of truth.
+func TestGenerateDiffAddedPathAnchorsOnThis(t *testing.T) {
+	p := newTestPlugin()
+
+	field := &descriptor.FieldDescriptorProto{
+		Name:   strPtr("g"),
+		Number: int32Ptr(1),
+		Label:  labelRepeated(),
+		Type:   typePtr(descriptor.FieldDescriptorProto_TYPE_INT32),
+	}
+	desc := &generator.Descriptor{
+		DescriptorProto: &descriptor.DescriptorProto{
+			Name:  strPtr("Msg"),
+			Field: []*descriptor.FieldDescriptorProto{field},
+		},
+	}
+
+	p.generateDiff(desc, false)
+	out := p.String()
+
+	if !strings.Contains(out, `Sprintf("G[%d]", e.ThisIndex), Kind: `+p.diffLit("Added")) {
+		t.Fatalf("expected Added diff path to use e.ThisIndex as the replay anchor, got:\n%s", out)
+	}
+}
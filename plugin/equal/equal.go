@@ -170,6 +170,8 @@ package equal
 import (
 	"github.com/dropbox/goprotoc/gogoproto"
 	"github.com/dropbox/goprotoc/protoc-gen-dgo/generator"
+
+	descriptor "github.com/dropbox/goprotoc/protoc-gen-dgo/descriptor"
 )
 
 type plugin struct {
@@ -202,6 +204,7 @@ func (p *plugin) Generate(file *generator.FileDescriptor) {
 			p.generateMessage(msg, false, gogoproto.HasExtensionsMap(file.FileDescriptorProto, msg.DescriptorProto))
 		}
 	}
+	p.generateV2(file)
 }
 
 func (p *plugin) generateMessage(message *generator.Descriptor, verbose bool, hasExtensionsMap bool) {
@@ -268,8 +271,115 @@ func (p *plugin) generateMessage(message *generator.Descriptor, verbose bool, ha
 	p.Out()
 	p.P(`}`)
 
+	oneofFields := map[int32][]*descriptor.FieldDescriptorProto{}
 	for _, field := range message.Field {
+		if field.OneofIndex != nil {
+			oneofFields[*field.OneofIndex] = append(oneofFields[*field.OneofIndex], field)
+		}
+	}
+	handled := map[int32]bool{}
+	for oneofIndex, fields := range oneofFields {
+		oneofName := message.DescriptorProto.GetOneofDecl()[oneofIndex].GetName()
+		goFieldName := generator.CamelCase(oneofName)
+		p.P(`if (this.`, goFieldName, ` == nil) != (that1.`, goFieldName, ` == nil) {`)
+		p.In()
+		if verbose {
+			p.P(`return `, p.Pkg["fmt"], `.Errorf("that.`, goFieldName, ` is not equal to this.`, goFieldName, `")`)
+		} else {
+			p.P(`return false`)
+		}
+		p.Out()
+		p.P(`}`)
+		p.P(`if this.`, goFieldName, ` != nil {`)
+		p.In()
+		p.P(`switch this`, goFieldName, ` := this.`, goFieldName, `.(type) {`)
+		for _, field := range fields {
+			fieldname := p.GetFieldName(message, field)
+			wrapperType := ccTypeName + `_` + generator.CamelCase(fieldname)
+			p.P(`case *`, wrapperType, `:`)
+			p.In()
+			p.P(`that`, goFieldName, `, ok := that1.`, goFieldName, `.(*`, wrapperType, `)`)
+			p.P(`if !ok {`)
+			p.In()
+			if verbose {
+				p.P(`return `, p.Pkg["fmt"], `.Errorf("that.`, goFieldName, ` is not of type *`, wrapperType, `")`)
+			} else {
+				p.P(`return false`)
+			}
+			p.Out()
+			p.P(`}`)
+			if field.IsMessage() || p.IsGroup(field) {
+				p.P(`if !this`, goFieldName, `.`, fieldname, `.Equal(that`, goFieldName, `.`, fieldname, `) {`)
+			} else if field.IsBytes() {
+				p.P(`if !`, p.bytesPkg.Use(), `.Equal(this`, goFieldName, `.`, fieldname, `, that`, goFieldName, `.`, fieldname, `) {`)
+			} else {
+				p.P(`if this`, goFieldName, `.`, fieldname, ` != that`, goFieldName, `.`, fieldname, ` {`)
+			}
+			p.In()
+			if verbose {
+				p.P(`return `, p.Pkg["fmt"], `.Errorf("`, fieldname, ` this(%v) Not Equal that(%v)", this`, goFieldName, `.`, fieldname, `, that`, goFieldName, `.`, fieldname, `)`)
+			} else {
+				p.P(`return false`)
+			}
+			p.Out()
+			p.P(`}`)
+			p.Out()
+		}
+		p.P(`}`)
+		p.Out()
+		p.P(`}`)
+		for _, field := range fields {
+			handled[field.GetNumber()] = true
+		}
+	}
+
+	for _, field := range message.Field {
+		if handled[field.GetNumber()] {
+			continue
+		}
 		fieldname := p.GetFieldName(message, field)
+		if field.IsMap(message.DescriptorProto) {
+			valueField := field.MapValueField(message.DescriptorProto)
+			p.P(`if len(this.`, fieldname, `) != len(that1.`, fieldname, `) {`)
+			p.In()
+			if verbose {
+				p.P(`return `, p.Pkg["fmt"], `.Errorf("that.`, fieldname, ` is not equal to this.`, fieldname, `")`)
+			} else {
+				p.P(`return false`)
+			}
+			p.Out()
+			p.P(`}`)
+			p.P(`for k, v := range this.`, fieldname, ` {`)
+			p.In()
+			p.P(`v2, ok := that1.`, fieldname, `[k]`)
+			p.P(`if !ok {`)
+			p.In()
+			if verbose {
+				p.P(`return `, p.Pkg["fmt"], `.Errorf("`, fieldname, `[%v] Not In that", k)`)
+			} else {
+				p.P(`return false`)
+			}
+			p.Out()
+			p.P(`}`)
+			if valueField.IsMessage() {
+				p.P(`if !v.Equal(v2) {`)
+			} else if valueField.IsBytes() {
+				p.P(`if !`, p.bytesPkg.Use(), `.Equal(v, v2) {`)
+			} else {
+				p.P(`if v != v2 {`)
+			}
+			p.In()
+			if verbose {
+				p.P(`return `, p.Pkg["fmt"], `.Errorf("`, fieldname, `[%v] this(%v) Not Equal that(%v)", k, v, v2)`)
+			} else {
+				p.P(`return false`)
+			}
+			p.Out()
+			p.P(`}`)
+			p.Out()
+			p.P(`}`)
+			continue
+		}
 		repeated := field.IsRepeated()
 		if repeated {
 			p.P(`if this.`, generator.SizerName(fieldname), ` != that1.`, generator.SizerName(fieldname), ` {`)
@@ -0,0 +1,234 @@
+// Copyright (c) 2013, Vastech SA (PTY) LTD. All rights reserved.
+// http://code.google.com/p/gogoprotobuf
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package equal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dropbox/goprotoc/protoc-gen-dgo/generator"
+
+	descriptor "github.com/dropbox/goprotoc/protoc-gen-dgo/descriptor"
+)
+
+// newTestPlugin returns an equal plugin wired up against a fresh generator,
+// ready to have generateMessage called against hand built descriptors. This
+// drives the same code path Generate does, without needing a real protoc
+// invocation.
+func newTestPlugin() *plugin {
+	p := NewPlugin()
+	p.Init(generator.New())
+	p.PluginImports = generator.NewPluginImports(p.Generator)
+	p.bytesPkg = p.NewImport("bytes")
+	return p
+}
+
+func strPtr(s string) *string { return &s }
+func int32Ptr(i int32) *int32 { return &i }
+
+func labelOptional() *descriptor.FieldDescriptorProto_Label {
+	l := descriptor.FieldDescriptorProto_LABEL_OPTIONAL
+	return &l
+}
+
+func labelRepeated() *descriptor.FieldDescriptorProto_Label {
+	l := descriptor.FieldDescriptorProto_LABEL_REPEATED
+	return &l
+}
+
+func typePtr(t descriptor.FieldDescriptorProto_Type) *descriptor.FieldDescriptorProto_Type {
+	return &t
+}
+
+// TestGenerateMessageOneofWithMessage checks that a oneof whose variant is a
+// message field dispatches through the wrapper type switch and compares the
+// payload with Equal, as plugin/equal/equal.go:274-334 implements.
+func TestGenerateMessageOneofWithMessage(t *testing.T) {
+	p := newTestPlugin()
+
+	field := &descriptor.FieldDescriptorProto{
+		Name:       strPtr("sub"),
+		Number:     int32Ptr(1),
+		Label:      labelOptional(),
+		Type:       typePtr(descriptor.FieldDescriptorProto_TYPE_MESSAGE),
+		TypeName:   strPtr(".test.Sub"),
+		OneofIndex: int32Ptr(0),
+	}
+	desc := &generator.Descriptor{
+		DescriptorProto: &descriptor.DescriptorProto{
+			Name:       strPtr("Msg"),
+			Field:      []*descriptor.FieldDescriptorProto{field},
+			OneofDecl:  []*descriptor.OneofDescriptorProto{{Name: strPtr("u")}},
+		},
+	}
+
+	p.generateMessage(desc, false, false)
+	out := p.String()
+
+	if !strings.Contains(out, "switch thisU := this.U.(type)") {
+		t.Fatalf("expected oneof type switch, got:\n%s", out)
+	}
+	if !strings.Contains(out, "case *Msg_Sub:") {
+		t.Fatalf("expected wrapper type case for message variant, got:\n%s", out)
+	}
+	if !strings.Contains(out, "thisU.Sub.Equal(thatU.Sub)") {
+		t.Fatalf("expected recursive Equal on message variant, got:\n%s", out)
+	}
+}
+
+// TestGenerateMessageOneofWithScalar checks that a oneof whose variant is a
+// scalar field compares with != instead of Equal/bytes.Equal.
+func TestGenerateMessageOneofWithScalar(t *testing.T) {
+	p := newTestPlugin()
+
+	field := &descriptor.FieldDescriptorProto{
+		Name:       strPtr("n"),
+		Number:     int32Ptr(1),
+		Label:      labelOptional(),
+		Type:       typePtr(descriptor.FieldDescriptorProto_TYPE_INT32),
+		OneofIndex: int32Ptr(0),
+	}
+	desc := &generator.Descriptor{
+		DescriptorProto: &descriptor.DescriptorProto{
+			Name:      strPtr("Msg"),
+			Field:     []*descriptor.FieldDescriptorProto{field},
+			OneofDecl: []*descriptor.OneofDescriptorProto{{Name: strPtr("u")}},
+		},
+	}
+
+	p.generateMessage(desc, false, false)
+	out := p.String()
+
+	if !strings.Contains(out, "case *Msg_N:") {
+		t.Fatalf("expected wrapper type case for scalar variant, got:\n%s", out)
+	}
+	if !strings.Contains(out, "if thisU.N != thatU.N {") {
+		t.Fatalf("expected scalar != comparison on scalar variant, got:\n%s", out)
+	}
+}
+
+// TestGenerateMessageMapStringMessage checks map<string, Sub> fields compare
+// key presence and recurse into Equal for the message value.
+func TestGenerateMessageMapStringMessage(t *testing.T) {
+	p := newTestPlugin()
+
+	keyField := &descriptor.FieldDescriptorProto{
+		Name:   strPtr("key"),
+		Number: int32Ptr(1),
+		Label:  labelOptional(),
+		Type:   typePtr(descriptor.FieldDescriptorProto_TYPE_STRING),
+	}
+	valueField := &descriptor.FieldDescriptorProto{
+		Name:     strPtr("value"),
+		Number:   int32Ptr(2),
+		Label:    labelOptional(),
+		Type:     typePtr(descriptor.FieldDescriptorProto_TYPE_MESSAGE),
+		TypeName: strPtr(".test.Sub"),
+	}
+	entry := &descriptor.DescriptorProto{
+		Name:    strPtr("MEntry"),
+		Field:   []*descriptor.FieldDescriptorProto{keyField, valueField},
+		Options: &descriptor.MessageOptions{MapEntry: boolPtr(true)},
+	}
+	mapField := &descriptor.FieldDescriptorProto{
+		Name:     strPtr("m"),
+		Number:   int32Ptr(1),
+		Label:    labelRepeated(),
+		Type:     typePtr(descriptor.FieldDescriptorProto_TYPE_MESSAGE),
+		TypeName: strPtr(".test.Msg.MEntry"),
+	}
+	desc := &generator.Descriptor{
+		DescriptorProto: &descriptor.DescriptorProto{
+			Name:       strPtr("Msg"),
+			Field:      []*descriptor.FieldDescriptorProto{mapField},
+			NestedType: []*descriptor.DescriptorProto{entry},
+		},
+	}
+
+	p.generateMessage(desc, false, false)
+	out := p.String()
+
+	if !strings.Contains(out, "for k, v := range this.M {") {
+		t.Fatalf("expected map range over this.M, got:\n%s", out)
+	}
+	if !strings.Contains(out, "v2, ok := that1.M[k]") {
+		t.Fatalf("expected key lookup on that1.M, got:\n%s", out)
+	}
+	if !strings.Contains(out, "if !v.Equal(v2) {") {
+		t.Fatalf("expected recursive Equal on message map value, got:\n%s", out)
+	}
+}
+
+// TestGenerateMessageMapInt32Bytes checks map<int32, bytes> fields compare
+// their values with bytes.Equal.
+func TestGenerateMessageMapInt32Bytes(t *testing.T) {
+	p := newTestPlugin()
+
+	keyField := &descriptor.FieldDescriptorProto{
+		Name:   strPtr("key"),
+		Number: int32Ptr(1),
+		Label:  labelOptional(),
+		Type:   typePtr(descriptor.FieldDescriptorProto_TYPE_INT32),
+	}
+	valueField := &descriptor.FieldDescriptorProto{
+		Name:   strPtr("value"),
+		Number: int32Ptr(2),
+		Label:  labelOptional(),
+		Type:   typePtr(descriptor.FieldDescriptorProto_TYPE_BYTES),
+	}
+	entry := &descriptor.DescriptorProto{
+		Name:    strPtr("MEntry"),
+		Field:   []*descriptor.FieldDescriptorProto{keyField, valueField},
+		Options: &descriptor.MessageOptions{MapEntry: boolPtr(true)},
+	}
+	mapField := &descriptor.FieldDescriptorProto{
+		Name:     strPtr("m"),
+		Number:   int32Ptr(1),
+		Label:    labelRepeated(),
+		Type:     typePtr(descriptor.FieldDescriptorProto_TYPE_MESSAGE),
+		TypeName: strPtr(".test.Msg.MEntry"),
+	}
+	desc := &generator.Descriptor{
+		DescriptorProto: &descriptor.DescriptorProto{
+			Name:       strPtr("Msg"),
+			Field:      []*descriptor.FieldDescriptorProto{mapField},
+			NestedType: []*descriptor.DescriptorProto{entry},
+		},
+	}
+
+	p.generateMessage(desc, false, false)
+	out := p.String()
+
+	if !strings.Contains(out, "for k, v := range this.M {") {
+		t.Fatalf("expected map range over this.M, got:\n%s", out)
+	}
+	if !strings.Contains(out, "if !bytes.Equal(v, v2) {") {
+		t.Fatalf("expected bytes.Equal on bytes map value, got:\n%s", out)
+	}
+}
+
+func boolPtr(b bool) *bool { return &b }
@@ -0,0 +1,327 @@
+// Copyright (c) 2013, Vastech SA (PTY) LTD. All rights reserved.
+// http://code.google.com/p/gogoprotobuf
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+/*
+equal_v2.go adds an opt-in v2 mode to the equal plugin whose semantics match
+google.golang.org/protobuf/proto.Equal instead of the legacy Equal/
+VerboseEqual behavior documented in equal.go:
+
+  - two messages are equal iff they have the same set of populated fields
+    with equal values - a default-valued proto3 scalar is indistinguishable
+    from an unset one;
+  - NaN float/double fields compare equal to themselves;
+  - unknown fields are compared after normalization (sorted by tag, with
+    duplicate length-delimited tags merged), not byte-for-byte.
+
+v2 is enabled using the following extensions:
+
+  - equal_v2
+  - equal_v2_all
+
+and generates, alongside Equal/VerboseEqual, a
+
+	func (this *T) EqualMessage(x protoreflect.Message) bool
+
+adapter so generated types satisfy a common Equaler interface usable by
+generic code. The legacy extensions (equal, equal_all, verbose_equal,
+verbose_equal_all) keep generating the original, stricter methods side by
+side - v2 is additive, not a replacement.
+*/
+package equal
+
+import (
+	"github.com/dropbox/goprotoc/gogoproto"
+	"github.com/dropbox/goprotoc/protoc-gen-dgo/generator"
+
+	descriptor "github.com/dropbox/goprotoc/protoc-gen-dgo/descriptor"
+)
+
+func (p *plugin) generateV2(file *generator.FileDescriptor) {
+	for _, msg := range file.Messages() {
+		if gogoproto.HasEqualV2(file.FileDescriptorProto, msg.DescriptorProto) {
+			p.generateMessageV2(msg, file.GetSyntax() == "proto3", gogoproto.HasExtensionsMap(file.FileDescriptorProto, msg.DescriptorProto))
+		}
+	}
+}
+
+func (p *plugin) isFloatOrDouble(field *descriptor.FieldDescriptorProto) bool {
+	t := field.GetType()
+	return t == descriptor.FieldDescriptorProto_TYPE_FLOAT || t == descriptor.FieldDescriptorProto_TYPE_DOUBLE
+}
+
+// scalarEqualV2 returns a boolean Go expression comparing a and b (both
+// non-repeated scalar field accessor expressions of the same type as
+// field), matching proto.Equal's NaN-equals-NaN rule for floats/doubles.
+func (p *plugin) scalarEqualV2(field *descriptor.FieldDescriptorProto, a, b string) string {
+	if p.isFloatOrDouble(field) {
+		mathPkg := p.NewImport("math")
+		return a + ` == ` + b + ` || (` + mathPkg.Use() + `.IsNaN(float64(` + a + `)) && ` + mathPkg.Use() + `.IsNaN(float64(` + b + `)))`
+	}
+	return a + ` == ` + b
+}
+
+func (p *plugin) generateMessageV2(message *generator.Descriptor, proto3 bool, hasExtensionsMap bool) {
+	ccTypeName := generator.CamelCaseSlice(message.TypeName())
+	canonicalPkg := p.NewImport("github.com/dropbox/goprotoc/canonical")
+
+	p.P(`func (this *`, ccTypeName, `) EqualV2(that interface{}) bool {`)
+	p.In()
+	p.P(`that1, ok := that.(*`, ccTypeName, `)`)
+	p.P(`if !ok {`)
+	p.In()
+	p.P(`return false`)
+	p.Out()
+	p.P(`}`)
+	p.P(`if this == nil || that1 == nil {`)
+	p.In()
+	p.P(`return this == nil && that1 == nil`)
+	p.Out()
+	p.P(`}`)
+
+	oneofFields := map[int32][]*descriptor.FieldDescriptorProto{}
+	for _, field := range message.Field {
+		if field.OneofIndex != nil {
+			oneofFields[*field.OneofIndex] = append(oneofFields[*field.OneofIndex], field)
+		}
+	}
+
+	handled := map[int32]bool{}
+	for oneofIndex, fields := range oneofFields {
+		oneofName := message.DescriptorProto.GetOneofDecl()[oneofIndex].GetName()
+		goFieldName := generator.CamelCase(oneofName)
+		p.P(`if (this.`, goFieldName, ` == nil) != (that1.`, goFieldName, ` == nil) {`)
+		p.In()
+		p.P(`return false`)
+		p.Out()
+		p.P(`}`)
+		p.P(`if this.`, goFieldName, ` != nil {`)
+		p.In()
+		p.P(`switch thisv := this.`, goFieldName, `.(type) {`)
+		for _, field := range fields {
+			fieldname := p.GetFieldName(message, field)
+			wrapperType := ccTypeName + `_` + generator.CamelCase(fieldname)
+			p.P(`case *`, wrapperType, `:`)
+			p.In()
+			p.P(`thatv, ok := that1.`, goFieldName, `.(*`, wrapperType, `)`)
+			p.P(`if !ok {`)
+			p.In()
+			p.P(`return false`)
+			p.Out()
+			p.P(`}`)
+			if field.IsMessage() || p.IsGroup(field) {
+				p.P(`if !thisv.`, fieldname, `.EqualV2(thatv.`, fieldname, `) {`)
+			} else if field.IsBytes() {
+				bytesPkg := p.NewImport("bytes")
+				p.P(`if !`, bytesPkg.Use(), `.Equal(thisv.`, fieldname, `, thatv.`, fieldname, `) {`)
+			} else {
+				p.P(`if !(`, p.scalarEqualV2(field, `thisv.`+fieldname, `thatv.`+fieldname), `) {`)
+			}
+			p.In()
+			p.P(`return false`)
+			p.Out()
+			p.P(`}`)
+			p.Out()
+		}
+		p.P(`}`)
+		p.Out()
+		p.P(`}`)
+		for _, field := range fields {
+			handled[field.GetNumber()] = true
+		}
+	}
+
+	for _, field := range message.Field {
+		if handled[field.GetNumber()] {
+			continue
+		}
+		fieldname := p.GetFieldName(message, field)
+		if field.IsMap(message.DescriptorProto) {
+			valueField := field.MapValueField(message.DescriptorProto)
+			p.P(`if len(this.`, fieldname, `) != len(that1.`, fieldname, `) {`)
+			p.In()
+			p.P(`return false`)
+			p.Out()
+			p.P(`}`)
+			p.P(`for k, v := range this.`, fieldname, ` {`)
+			p.In()
+			p.P(`v2, ok := that1.`, fieldname, `[k]`)
+			p.P(`if !ok {`)
+			p.In()
+			p.P(`return false`)
+			p.Out()
+			p.P(`}`)
+			if valueField.IsMessage() {
+				p.P(`if !v.EqualV2(v2) {`)
+			} else if valueField.IsBytes() {
+				bytesPkg := p.NewImport("bytes")
+				p.P(`if !`, bytesPkg.Use(), `.Equal(v, v2) {`)
+			} else {
+				p.P(`if !(`, p.scalarEqualV2(valueField, `v`, `v2`), `) {`)
+			}
+			p.In()
+			p.P(`return false`)
+			p.Out()
+			p.P(`}`)
+			p.Out()
+			p.P(`}`)
+			continue
+		}
+
+		if field.IsRepeated() {
+			p.P(`if len(this.`, fieldname, `) != len(that1.`, fieldname, `) {`)
+			p.In()
+			p.P(`return false`)
+			p.Out()
+			p.P(`}`)
+			p.P(`for i := range this.`, fieldname, ` {`)
+			p.In()
+			if field.IsMessage() || p.IsGroup(field) {
+				p.P(`if !this.`, fieldname, `[i].EqualV2(that1.`, fieldname, `[i]) {`)
+			} else if field.IsBytes() {
+				bytesPkg := p.NewImport("bytes")
+				p.P(`if !`, bytesPkg.Use(), `.Equal(this.`, fieldname, `[i], that1.`, fieldname, `[i]) {`)
+			} else {
+				p.P(`if !(`, p.scalarEqualV2(field, `this.`+fieldname+`[i]`, `that1.`+fieldname+`[i]`), `) {`)
+			}
+			p.In()
+			p.P(`return false`)
+			p.Out()
+			p.P(`}`)
+			p.Out()
+			p.P(`}`)
+			continue
+		}
+
+		if field.IsMessage() || p.IsGroup(field) {
+			p.P(`if this.`, generator.SetterName(fieldname), ` != that1.`, generator.SetterName(fieldname), ` {`)
+			p.In()
+			p.P(`return false`)
+			p.Out()
+			p.P(`}`)
+			p.P(`if this.`, generator.SetterName(fieldname), ` && !this.`, fieldname, `.EqualV2(that1.`, fieldname, `) {`)
+			p.In()
+			p.P(`return false`)
+			p.Out()
+			p.P(`}`)
+			continue
+		}
+
+		if field.IsBytes() {
+			bytesPkg := p.NewImport("bytes")
+			present := `this.` + generator.SetterName(fieldname)
+			if proto3 {
+				p.P(`if !`, bytesPkg.Use(), `.Equal(this.`, fieldname, `, that1.`, fieldname, `) {`)
+			} else {
+				p.P(`if `, present, ` != that1.`, generator.SetterName(fieldname), ` {`)
+				p.In()
+				p.P(`return false`)
+				p.Out()
+				p.P(`}`)
+				p.P(`if `, present, ` && !`, bytesPkg.Use(), `.Equal(this.`, fieldname, `, that1.`, fieldname, `) {`)
+			}
+			p.In()
+			p.P(`return false`)
+			p.Out()
+			p.P(`}`)
+			continue
+		}
+
+		// Plain scalar. In proto3 a default-valued field is indistinguishable
+		// from an unset one, so the has-bit is ignored and only the value is
+		// compared (matching proto.Equal); in proto2 the has-bits must also
+		// agree.
+		if proto3 {
+			p.P(`if !(`, p.scalarEqualV2(field, `this.`+fieldname, `that1.`+fieldname), `) {`)
+			p.In()
+			p.P(`return false`)
+			p.Out()
+			p.P(`}`)
+		} else {
+			p.P(`if this.`, generator.SetterName(fieldname), ` != that1.`, generator.SetterName(fieldname), ` {`)
+			p.In()
+			p.P(`return false`)
+			p.Out()
+			p.P(`}`)
+			p.P(`if this.`, generator.SetterName(fieldname), ` && !(`, p.scalarEqualV2(field, `this.`+fieldname, `that1.`+fieldname), `) {`)
+			p.In()
+			p.P(`return false`)
+			p.Out()
+			p.P(`}`)
+		}
+	}
+
+	if message.DescriptorProto.HasExtension() {
+		fieldname := "XXX_extensions"
+		if hasExtensionsMap {
+			p.P(`if len(this.`, fieldname, `) != len(that1.`, fieldname, `) {`)
+			p.In()
+			p.P(`return false`)
+			p.Out()
+			p.P(`}`)
+			p.P(`for k, v := range this.`, fieldname, ` {`)
+			p.In()
+			p.P(`v2, ok := that1.`, fieldname, `[k]`)
+			p.P(`if !ok || !v.Equal(&v2) {`)
+			p.In()
+			p.P(`return false`)
+			p.Out()
+			p.P(`}`)
+			p.Out()
+			p.P(`}`)
+		} else {
+			bytesPkg := p.NewImport("bytes")
+			p.P(`if !`, bytesPkg.Use(), `.Equal(this.`, fieldname, `, that1.`, fieldname, `) {`)
+			p.In()
+			p.P(`return false`)
+			p.Out()
+			p.P(`}`)
+		}
+	}
+
+	bytesPkg := p.NewImport("bytes")
+	p.P(`if !`, bytesPkg.Use(), `.Equal(`, canonicalPkg.Use(), `.NormalizeUnrecognized(this.XXX_unrecognized), `, canonicalPkg.Use(), `.NormalizeUnrecognized(that1.XXX_unrecognized)) {`)
+	p.In()
+	p.P(`return false`)
+	p.Out()
+	p.P(`}`)
+	p.P(`return true`)
+	p.Out()
+	p.P(`}`)
+	p.P(``)
+
+	p.P(`func (this *`, ccTypeName, `) EqualMessage(x `, p.NewImport("google.golang.org/protobuf/reflect/protoreflect").Use(), `.Message) bool {`)
+	p.In()
+	p.P(`other, ok := x.Interface().(*`, ccTypeName, `)`)
+	p.P(`if !ok {`)
+	p.In()
+	p.P(`return false`)
+	p.Out()
+	p.P(`}`)
+	p.P(`return this.EqualV2(other)`)
+	p.Out()
+	p.P(`}`)
+	p.P(``)
+}